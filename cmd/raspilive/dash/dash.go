@@ -6,9 +6,10 @@ import (
 	"os/signal"
 	"time"
 
-	"github.com/jaredpetersen/raspilive/internal/ffmpeg/dash"
+	"github.com/jaredpetersen/raspilive/internal/ffmpeg/mpegdash"
 	"github.com/jaredpetersen/raspilive/internal/raspivid"
 	"github.com/jaredpetersen/raspilive/internal/server"
+	"github.com/jaredpetersen/raspilive/internal/video"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
@@ -17,18 +18,23 @@ const serverShutdownDeadline = 10 * time.Second
 
 // Cfg represents the configuration for DASH.
 type Cfg struct {
-	Width          int
-	Height         int
-	Fps            int
-	HorizontalFlip bool
-	VerticalFlip   bool
-	Port           int
-	Directory      string
-	TLSCert        string
-	TLSKey         string
-	SegmentTime    int // Segment length target duration in seconds
-	PlaylistSize   int // Maximum number of playlist entries
-	StorageSize    int // Maximum number of unreferenced segments to keep on disk before removal
+	Width             int
+	Height            int
+	Fps               int
+	HorizontalFlip    bool
+	VerticalFlip      bool
+	Port              int
+	Directory         string
+	TLSCert           string
+	TLSKey            string
+	SegmentTime       int // Segment length target duration in seconds
+	PlaylistSize      int // Maximum number of playlist entries
+	StorageSize       int // Maximum number of unreferenced segments to keep on disk before removal
+	NoPlayer          bool
+	IdleTimeout       time.Duration // How long to wait without a viewer before stopping the pipeline
+	Record            string        // Directory to write a concurrent MP4 recording tee to; empty disables it
+	RecordSegmentTime time.Duration // Rolling recording segment duration
+	RecordRetention   time.Duration // Delete recording files older than this; zero disables cleanup
 }
 
 // Cmd is a DASH command for Cobra.
@@ -65,6 +71,16 @@ func init() {
 
 	Cmd.Flags().IntVar(&cfg.StorageSize, "storage-size", 0, "maximum number of unreferenced segments to keep on disk before removal")
 
+	Cmd.Flags().BoolVar(&cfg.NoPlayer, "no-player", false, "disable the built-in player page served at \"/\"")
+
+	Cmd.Flags().DurationVar(&cfg.IdleTimeout, "idle-timeout", 60*time.Second, "how long to wait without a viewer before stopping the video pipeline")
+
+	Cmd.Flags().StringVar(&cfg.Record, "record", "", "directory to write a concurrent MP4 recording tee to")
+
+	Cmd.Flags().DurationVar(&cfg.RecordSegmentTime, "record-segment-time", 10*time.Minute, "rolling recording segment duration, used with --record")
+
+	Cmd.Flags().DurationVar(&cfg.RecordRetention, "record-retention", 0, "delete recording files older than this, used with --record")
+
 	Cmd.Flags().SortFlags = false
 
 	Cmd.Run = func(cmd *cobra.Command, args []string) {
@@ -73,15 +89,15 @@ func init() {
 }
 
 func streamDash(cfg Cfg) {
-	raspiStream := newRaspiStream(cfg)
-	muxer := newMuxer(cfg)
-	srv := newServer(cfg)
+	manager := newManager(cfg)
+	srv := newServer(cfg, manager)
 
 	// Set up a channel for exiting
 	stop := make(chan struct{})
 	osStopper(stop)
 
-	// Serve files generated by the video stream
+	// Serve files generated by the video stream, starting and stopping it on demand based on
+	// viewer activity
 	go func() {
 		err := srv.ListenAndServe()
 		if err != nil && errors.Is(err, server.ErrInvalidDirectory) {
@@ -93,58 +109,52 @@ func streamDash(cfg Cfg) {
 		stop <- struct{}{}
 	}()
 
-	// Stream video
-	go func() {
-		if err := mux(raspiStream, muxer); err != nil {
-			log.Fatal().Msg("Encountered an error muxing video")
-		}
-		stop <- struct{}{}
-	}()
-
 	// Wait for a stop signal
 	<-stop
 
 	log.Info().Msg("Shutting down")
 
-	raspiStream.Video.Close()
+	manager.Stop()
 	srv.Shutdown(serverShutdownDeadline)
 }
 
-func newRaspiStream(cfg Cfg) *raspivid.Stream {
-	raspiOptions := raspivid.Options{
-		Width:          cfg.Width,
-		Height:         cfg.Height,
-		Fps:            cfg.Fps,
-		HorizontalFlip: cfg.HorizontalFlip,
-		VerticalFlip:   cfg.VerticalFlip,
-	}
-
-	raspiStream, err := raspivid.NewStream(raspiOptions)
-	if err != nil {
-		log.Fatal().Msg("Encountered an error streaming video from the Raspberry Pi Camera Module")
-	}
-
-	return raspiStream
-}
-
-func newMuxer(cfg Cfg) *dash.Muxer {
-	return &dash.Muxer{
-		Directory: cfg.Directory,
-		Options: dash.Options{
-			Fps:          cfg.Fps,
-			SegmentTime:  cfg.SegmentTime,
-			PlaylistSize: cfg.PlaylistSize,
-			StorageSize:  cfg.StorageSize,
+func newManager(cfg Cfg) *video.Manager {
+	return &video.Manager{
+		NewStream: func() (*raspivid.Stream, error) {
+			return raspivid.NewStream(raspivid.Options{
+				Width:          cfg.Width,
+				Height:         cfg.Height,
+				Fps:            cfg.Fps,
+				HorizontalFlip: cfg.HorizontalFlip,
+				VerticalFlip:   cfg.VerticalFlip,
+			})
+		},
+		NewMuxer: func() video.LifecycleMuxer {
+			return &mpegdash.Muxer{
+				Directory:    cfg.Directory,
+				Fps:          cfg.Fps,
+				SegmentTime:  cfg.SegmentTime,
+				PlaylistSize: cfg.PlaylistSize,
+				StorageSize:  cfg.StorageSize,
+				Record: mpegdash.Record{
+					Directory:   cfg.Record,
+					SegmentTime: cfg.RecordSegmentTime,
+					Retention:   cfg.RecordRetention,
+				},
+			}
 		},
+		IdleTimeout: cfg.IdleTimeout,
 	}
 }
 
-func newServer(cfg Cfg) *server.Static {
+func newServer(cfg Cfg, manager *video.Manager) *server.Static {
 	return &server.Static{
-		Port:      cfg.Port,
-		Directory: cfg.Directory,
-		Cert:      cfg.TLSCert,
-		Key:       cfg.TLSKey,
+		Port:              cfg.Port,
+		Directory:         cfg.Directory,
+		Cert:              cfg.TLSCert,
+		Key:               cfg.TLSKey,
+		NoPlayer:          cfg.NoPlayer,
+		OnManifestRequest: manager.Activity,
 	}
 }
 
@@ -159,19 +169,3 @@ func osStopper(stop chan struct{}) {
 		stop <- struct{}{}
 	}()
 }
-
-func mux(raspiStream *raspivid.Stream, muxer *dash.Muxer) error {
-	if err := muxer.Mux(raspiStream.Video); err != nil {
-		return err
-	}
-	if err := raspiStream.Start(); err != nil {
-		return err
-	}
-	if err := muxer.Wait(); err != nil {
-		return err
-	}
-	if err := raspiStream.Wait(); err != nil {
-		return err
-	}
-	return nil
-}
@@ -0,0 +1,146 @@
+package flv
+
+import (
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/jaredpetersen/raspilive/internal/ffmpeg/flv"
+	"github.com/jaredpetersen/raspilive/internal/raspivid"
+	serverflv "github.com/jaredpetersen/raspilive/internal/server/flv"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const serverShutdownDeadline = 10 * time.Second
+
+// Cfg represents the configuration for HTTP-FLV.
+type Cfg struct {
+	Width          int
+	Height         int
+	Fps            int
+	HorizontalFlip bool
+	VerticalFlip   bool
+	Port           int
+	TLSCert        string
+	TLSKey         string
+}
+
+// Cmd is an HTTP-FLV command for Cobra.
+var Cmd = &cobra.Command{
+	Use:   "flv",
+	Short: "Stream video using low-latency HTTP-FLV",
+	Long:  "Stream video using low-latency HTTP-FLV",
+}
+
+func init() {
+	cfg := Cfg{}
+
+	Cmd.Flags().IntVar(&cfg.Width, "width", 1920, "video width")
+
+	Cmd.Flags().IntVar(&cfg.Height, "height", 1080, "video height")
+
+	Cmd.Flags().IntVar(&cfg.Fps, "fps", 30, "video framerate")
+
+	Cmd.Flags().BoolVar(&cfg.HorizontalFlip, "horizontal-flip", false, "horizontally flip video")
+
+	Cmd.Flags().BoolVar(&cfg.VerticalFlip, "vertical-flip", false, "vertically flip video")
+
+	Cmd.Flags().IntVar(&cfg.Port, "port", 0, "HTTP-FLV server port")
+
+	Cmd.Flags().StringVar(&cfg.TLSCert, "tls-cert", "", "HTTP-FLV server TLS certificate")
+
+	Cmd.Flags().StringVar(&cfg.TLSKey, "tls-key", "", "HTTP-FLV server TLS key")
+
+	Cmd.Flags().SortFlags = false
+
+	Cmd.Run = func(cmd *cobra.Command, args []string) {
+		streamFlv(cfg)
+	}
+}
+
+func streamFlv(cfg Cfg) {
+	raspiStream := newRaspiStream(cfg)
+	muxer := &flv.Muxer{}
+	srv := newServer(cfg)
+
+	video, err := muxer.Mux(raspiStream.Video)
+	if err != nil {
+		log.Fatal().Msg("Encountered an error muxing video")
+	}
+	log.Debug().Str("cmd", muxer.String()).Msg("Started ffmpeg muxer")
+
+	// Set up a channel for exiting
+	stop := make(chan struct{})
+	osStopper(stop)
+
+	// Serve the FLV stream to connected viewers
+	go func() {
+		if err := srv.ListenAndServe(video); err != nil && err != http.ErrServerClosed {
+			log.Fatal().Msg("Encountered an error serving video")
+		}
+		stop <- struct{}{}
+	}()
+
+	// Stream video
+	go func() {
+		if err := raspiStream.Start(); err != nil {
+			log.Fatal().Msg("Encountered an error streaming video from the Raspberry Pi Camera Module")
+		}
+		log.Debug().Str("cmd", raspiStream.String()).Msg("Started raspivid")
+
+		if err := muxer.Wait(); err != nil {
+			log.Fatal().Msg("Encountered an error muxing video")
+		}
+		if err := raspiStream.Wait(); err != nil {
+			log.Fatal().Msg("Encountered an error streaming video from the Raspberry Pi Camera Module")
+		}
+		stop <- struct{}{}
+	}()
+
+	// Wait for a stop signal
+	<-stop
+
+	log.Info().Msg("Shutting down")
+
+	raspiStream.Video.Close()
+	srv.Shutdown(serverShutdownDeadline)
+}
+
+func newRaspiStream(cfg Cfg) *raspivid.Stream {
+	raspiOptions := raspivid.Options{
+		Width:          cfg.Width,
+		Height:         cfg.Height,
+		Fps:            cfg.Fps,
+		HorizontalFlip: cfg.HorizontalFlip,
+		VerticalFlip:   cfg.VerticalFlip,
+	}
+
+	raspiStream, err := raspivid.NewStream(raspiOptions)
+	if err != nil {
+		log.Fatal().Msg("Encountered an error streaming video from the Raspberry Pi Camera Module")
+	}
+
+	return raspiStream
+}
+
+func newServer(cfg Cfg) *serverflv.Server {
+	return &serverflv.Server{
+		Port: cfg.Port,
+		Cert: cfg.TLSCert,
+		Key:  cfg.TLSKey,
+	}
+}
+
+func osStopper(stop chan struct{}) {
+	// Set up a channel for OS signals so that we can quit gracefully if the user terminates the program
+	// Once we get this signal, sent a message to the stop channel
+	osStop := make(chan os.Signal, 1)
+	signal.Notify(osStop, os.Interrupt, os.Kill)
+
+	go func() {
+		<-osStop
+		stop <- struct{}{}
+	}()
+}
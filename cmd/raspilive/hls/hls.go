@@ -0,0 +1,179 @@
+package hls
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/jaredpetersen/raspilive/internal/ffmpeg/hls"
+	"github.com/jaredpetersen/raspilive/internal/raspivid"
+	"github.com/jaredpetersen/raspilive/internal/server"
+	"github.com/jaredpetersen/raspilive/internal/video"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const serverShutdownDeadline = 10 * time.Second
+
+// Cfg represents the configuration for HLS.
+type Cfg struct {
+	Width             int
+	Height            int
+	Fps               int
+	HorizontalFlip    bool
+	VerticalFlip      bool
+	Port              int
+	Directory         string
+	TLSCert           string
+	TLSKey            string
+	SegmentTime       int // Segment length target duration in seconds
+	PlaylistSize      int // Maximum number of playlist entries
+	StorageSize       int // Maximum number of unreferenced segments to keep on disk before removal
+	LLHLS             bool
+	PartDuration      float64       // Target CMAF partial segment duration in seconds, used when LLHLS is enabled
+	NoPlayer          bool
+	IdleTimeout       time.Duration // How long to wait without a viewer before stopping the pipeline
+	Record            string        // Directory to write a concurrent MP4 recording tee to; empty disables it
+	RecordSegmentTime time.Duration // Rolling recording segment duration
+	RecordRetention   time.Duration // Delete recording files older than this; zero disables cleanup
+}
+
+// Cmd is an HLS command for Cobra.
+var Cmd = &cobra.Command{
+	Use:   "hls",
+	Short: "Stream video using HLS",
+	Long:  "Stream video using HLS",
+}
+
+func init() {
+	cfg := Cfg{}
+
+	Cmd.Flags().IntVar(&cfg.Width, "width", 1920, "video width")
+
+	Cmd.Flags().IntVar(&cfg.Height, "height", 1080, "video height")
+
+	Cmd.Flags().IntVar(&cfg.Fps, "fps", 30, "video framerate")
+
+	Cmd.Flags().BoolVar(&cfg.HorizontalFlip, "horizontal-flip", false, "horizontally flip video")
+
+	Cmd.Flags().BoolVar(&cfg.VerticalFlip, "vertical-flip", false, "vertically flip video")
+
+	Cmd.Flags().IntVar(&cfg.Port, "port", 0, "static file server port")
+
+	Cmd.Flags().StringVar(&cfg.Directory, "directory", "", "static file server directory")
+
+	Cmd.Flags().StringVar(&cfg.TLSCert, "tls-cert", "", "static file server TLS certificate")
+
+	Cmd.Flags().StringVar(&cfg.TLSKey, "tls-key", "", "static file server TLS key")
+
+	Cmd.Flags().IntVar(&cfg.SegmentTime, "segment-time", 0, "target segment duration in seconds")
+
+	Cmd.Flags().IntVar(&cfg.PlaylistSize, "playlist-size", 0, "maximum number of playlist entries")
+
+	Cmd.Flags().IntVar(&cfg.StorageSize, "storage-size", 0, "maximum number of unreferenced segments to keep on disk before removal")
+
+	Cmd.Flags().BoolVar(&cfg.NoPlayer, "no-player", false, "disable the built-in player page served at \"/\"")
+
+	Cmd.Flags().BoolVar(&cfg.LLHLS, "ll-hls", false, "serve low-latency HLS with partial segments")
+
+	Cmd.Flags().Float64Var(&cfg.PartDuration, "part-duration", 0.33, "target partial segment duration in seconds, used with --ll-hls")
+
+	Cmd.Flags().DurationVar(&cfg.IdleTimeout, "idle-timeout", 60*time.Second, "how long to wait without a viewer before stopping the video pipeline")
+
+	Cmd.Flags().StringVar(&cfg.Record, "record", "", "directory to write a concurrent MP4 recording tee to")
+
+	Cmd.Flags().DurationVar(&cfg.RecordSegmentTime, "record-segment-time", 10*time.Minute, "rolling recording segment duration, used with --record")
+
+	Cmd.Flags().DurationVar(&cfg.RecordRetention, "record-retention", 0, "delete recording files older than this, used with --record")
+
+	Cmd.Flags().SortFlags = false
+
+	Cmd.Run = func(cmd *cobra.Command, args []string) {
+		streamHls(cfg)
+	}
+}
+
+func streamHls(cfg Cfg) {
+	manager := newManager(cfg)
+	srv := newServer(cfg, manager)
+
+	// Set up a channel for exiting
+	stop := make(chan struct{})
+	osStopper(stop)
+
+	// Serve files generated by the video stream, starting and stopping it on demand based on
+	// viewer activity
+	go func() {
+		err := srv.ListenAndServe()
+		if err != nil && errors.Is(err, server.ErrInvalidDirectory) {
+			log.Fatal().Msg("Directory does not exist")
+		}
+		if err != nil {
+			log.Fatal().Msg("Encountered an error serving video")
+		}
+		stop <- struct{}{}
+	}()
+
+	// Wait for a stop signal
+	<-stop
+
+	log.Info().Msg("Shutting down")
+
+	manager.Stop()
+	srv.Shutdown(serverShutdownDeadline)
+}
+
+func newManager(cfg Cfg) *video.Manager {
+	return &video.Manager{
+		NewStream: func() (*raspivid.Stream, error) {
+			return raspivid.NewStream(raspivid.Options{
+				Width:          cfg.Width,
+				Height:         cfg.Height,
+				Fps:            cfg.Fps,
+				HorizontalFlip: cfg.HorizontalFlip,
+				VerticalFlip:   cfg.VerticalFlip,
+			})
+		},
+		NewMuxer: func() video.LifecycleMuxer {
+			return &hls.Muxer{
+				Directory:    cfg.Directory,
+				Fps:          cfg.Fps,
+				SegmentTime:  cfg.SegmentTime,
+				PlaylistSize: cfg.PlaylistSize,
+				StorageSize:  cfg.StorageSize,
+				LLHLS:        cfg.LLHLS,
+				PartDuration: cfg.PartDuration,
+				Record: hls.Record{
+					Directory:   cfg.Record,
+					SegmentTime: cfg.RecordSegmentTime,
+					Retention:   cfg.RecordRetention,
+				},
+			}
+		},
+		IdleTimeout: cfg.IdleTimeout,
+	}
+}
+
+func newServer(cfg Cfg, manager *video.Manager) *server.Static {
+	return &server.Static{
+		Port:              cfg.Port,
+		Directory:         cfg.Directory,
+		Cert:              cfg.TLSCert,
+		Key:               cfg.TLSKey,
+		NoPlayer:          cfg.NoPlayer,
+		OnManifestRequest: manager.Activity,
+	}
+}
+
+func osStopper(stop chan struct{}) {
+	// Set up a channel for OS signals so that we can quit gracefully if the user terminates the program
+	// Once we get this signal, sent a message to the stop channel
+	osStop := make(chan os.Signal, 1)
+	signal.Notify(osStop, os.Interrupt, os.Kill)
+
+	go func() {
+		<-osStop
+		stop <- struct{}{}
+	}()
+}
@@ -0,0 +1,139 @@
+package rtmp
+
+import (
+	"os"
+	"os/signal"
+
+	"github.com/jaredpetersen/raspilive/internal/ffmpeg/rtmp"
+	"github.com/jaredpetersen/raspilive/internal/raspivid"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// Cfg represents the configuration for RTMP.
+type Cfg struct {
+	Width            int
+	Height           int
+	Fps              int
+	HorizontalFlip   bool
+	VerticalFlip     bool
+	Url              string
+	AudioSource      string
+	Bitrate          int
+	KeyframeInterval int
+}
+
+// Cmd is an RTMP command for Cobra.
+var Cmd = &cobra.Command{
+	Use:   "rtmp",
+	Short: "Broadcast video to a remote RTMP ingest",
+	Long:  "Broadcast video to a remote RTMP ingest",
+}
+
+func init() {
+	cfg := Cfg{}
+
+	Cmd.Flags().IntVar(&cfg.Width, "width", 1920, "video width")
+
+	Cmd.Flags().IntVar(&cfg.Height, "height", 1080, "video height")
+
+	Cmd.Flags().IntVar(&cfg.Fps, "fps", 30, "video framerate")
+
+	Cmd.Flags().BoolVar(&cfg.HorizontalFlip, "horizontal-flip", false, "horizontally flip video")
+
+	Cmd.Flags().BoolVar(&cfg.VerticalFlip, "vertical-flip", false, "vertically flip video")
+
+	Cmd.Flags().StringVar(&cfg.Url, "url", "", "RTMP ingest url, e.g. rtmp://a.rtmp.youtube.com/live2/<key>")
+
+	Cmd.Flags().StringVar(&cfg.AudioSource, "audio-source", "", "audio device or file to mux in alongside the video")
+
+	Cmd.Flags().IntVar(&cfg.Bitrate, "bitrate", 0, "target video bitrate in kbps")
+
+	Cmd.Flags().IntVar(&cfg.KeyframeInterval, "keyframe-interval", 0, "keyframe interval in frames")
+
+	Cmd.Flags().SortFlags = false
+
+	Cmd.Run = func(cmd *cobra.Command, args []string) {
+		streamRtmp(cfg)
+	}
+}
+
+func streamRtmp(cfg Cfg) {
+	raspiStream := newRaspiStream(cfg)
+	muxer := newMuxer(cfg)
+
+	// Set up a channel for exiting
+	stop := make(chan struct{})
+	osStopper(stop)
+
+	// Stream video
+	go func() {
+		if err := mux(raspiStream, muxer); err != nil {
+			log.Fatal().Msg("Encountered an error muxing video")
+		}
+		stop <- struct{}{}
+	}()
+
+	// Wait for a stop signal
+	<-stop
+
+	log.Info().Msg("Shutting down")
+
+	raspiStream.Video.Close()
+}
+
+func newRaspiStream(cfg Cfg) *raspivid.Stream {
+	raspiOptions := raspivid.Options{
+		Width:          cfg.Width,
+		Height:         cfg.Height,
+		Fps:            cfg.Fps,
+		HorizontalFlip: cfg.HorizontalFlip,
+		VerticalFlip:   cfg.VerticalFlip,
+	}
+
+	raspiStream, err := raspivid.NewStream(raspiOptions)
+	if err != nil {
+		log.Fatal().Msg("Encountered an error streaming video from the Raspberry Pi Camera Module")
+	}
+
+	return raspiStream
+}
+
+func newMuxer(cfg Cfg) *rtmp.Muxer {
+	return &rtmp.Muxer{
+		Url: cfg.Url,
+		Options: rtmp.Options{
+			AudioSource:      cfg.AudioSource,
+			Bitrate:          cfg.Bitrate,
+			KeyframeInterval: cfg.KeyframeInterval,
+		},
+	}
+}
+
+func osStopper(stop chan struct{}) {
+	// Set up a channel for OS signals so that we can quit gracefully if the user terminates the program
+	// Once we get this signal, sent a message to the stop channel
+	osStop := make(chan os.Signal, 1)
+	signal.Notify(osStop, os.Interrupt, os.Kill)
+
+	go func() {
+		<-osStop
+		stop <- struct{}{}
+	}()
+}
+
+func mux(raspiStream *raspivid.Stream, muxer *rtmp.Muxer) error {
+	if err := muxer.Mux(raspiStream.Video); err != nil {
+		return err
+	}
+	if err := raspiStream.Start(); err != nil {
+		return err
+	}
+	if err := muxer.Wait(); err != nil {
+		return err
+	}
+	if err := raspiStream.Wait(); err != nil {
+		return err
+	}
+	return nil
+}
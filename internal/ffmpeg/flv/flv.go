@@ -0,0 +1,61 @@
+// Package flv transforms a raw video stream into an FLV byte stream suitable for fanning out to
+// in-browser viewers (e.g. via flv.js).
+package flv
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Muxer represents a video transformation operation being prepared or run.
+type Muxer struct {
+	cmd *exec.Cmd
+}
+
+var execCommand = exec.Command
+
+// Mux begins muxing the video stream to FLV, returning a reader of the resulting byte stream.
+func (muxer *Muxer) Mux(video io.ReadCloser) (io.ReadCloser, error) {
+	cmd := execCommand("ffmpeg", args()...)
+	cmd.Stdin = video
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	muxer.cmd = cmd
+
+	return stdout, nil
+}
+
+// Wait waits for the video stream to finish processing.
+//
+// The mux operation must have been started by Mux.
+func (muxer *Muxer) Wait() error {
+	if muxer.cmd == nil {
+		return errors.New("ffmpeg flv: not started")
+	}
+
+	return muxer.cmd.Wait()
+}
+
+// String returns the ffmpeg command used to mux the video stream.
+func (muxer *Muxer) String() string {
+	return "ffmpeg " + strings.Join(args(), " ")
+}
+
+func args() []string {
+	return []string{
+		"-c:v", "copy",
+		"-f", "flv",
+		"-an",
+		"-",
+	}
+}
@@ -0,0 +1,286 @@
+// Package hls transforms a raw video stream into HLS segments and playlists.
+package hls
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultPartDuration is the target duration, in seconds, of each CMAF partial segment when
+// LL-HLS is enabled.
+const defaultPartDuration = 0.33
+
+// defaultRecordSegmentTime is the rolling recording segment duration used when Record.Directory
+// is set but Record.SegmentTime is not.
+const defaultRecordSegmentTime = 10 * time.Minute
+
+// retentionPollInterval is how often the recording directory is swept for expired files when
+// Record.Retention is set.
+const retentionPollInterval = 1 * time.Minute
+
+// Record configures a concurrent MP4 recording tee alongside the live HLS stream.
+type Record struct {
+	Directory   string
+	SegmentTime time.Duration // Rolling recording segment duration; defaults to 10 minutes
+	Retention   time.Duration // Delete recording files older than this; zero disables cleanup
+}
+
+// Muxer represents a video transformation operation being prepared or run.
+//
+// Ffmpeg will step in and use its own defaults if a value is not provided.
+type Muxer struct {
+	Directory    string
+	Fps          int // Framerate of the output video
+	SegmentTime  int // Segment length target duration in seconds
+	PlaylistSize int // Maximum number of playlist entries
+	StorageSize  int // Maximum number of unreferenced segments to keep on disk before removal
+	LLHLS        bool
+	PartDuration float64 // Target CMAF partial segment duration in seconds, used when LLHLS is enabled
+	Record       Record  // Concurrent MP4 recording tee; Record.Directory == "" disables it
+
+	cmd       *exec.Cmd
+	prefix    string
+	pruneStop chan struct{}
+	partStop  chan struct{}
+}
+
+var execCommand = exec.Command
+
+// Mux begins muxing the video stream to the HLS format.
+//
+// Mux generates a random filename prefix for the session so that restarting the muxer doesn't
+// reuse segment names a browser or upstream proxy may still have cached from a previous session.
+func (muxer *Muxer) Mux(video io.ReadCloser) error {
+	prefix, err := randomPrefix()
+	if err != nil {
+		return err
+	}
+	muxer.prefix = prefix
+
+	muxer.cmd = execCommand("ffmpeg", muxer.args()...)
+	muxer.cmd.Stdin = video
+
+	if err := muxer.cmd.Start(); err != nil {
+		return err
+	}
+
+	if muxer.Record.Directory != "" && muxer.Record.Retention != 0 {
+		muxer.pruneStop = make(chan struct{})
+		go pruneRecordings(muxer.Record.Directory, muxer.Record.Retention, muxer.pruneStop)
+	}
+
+	if muxer.LLHLS {
+		muxer.partStop = make(chan struct{})
+		manifest := path.Join(muxer.Directory, "livestream_"+muxer.prefix+".m3u8")
+		go synthesizeParts(manifest, muxer.partDuration(), muxer.partStop)
+	}
+
+	return nil
+}
+
+// pruneRecordings periodically deletes recording files older than retention from directory,
+// until stop is closed.
+func pruneRecordings(directory string, retention time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(retentionPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			matches, err := filepath.Glob(filepath.Join(directory, "rec_*.mp4"))
+			if err != nil {
+				continue
+			}
+
+			cutoff := time.Now().Add(-retention)
+
+			for _, match := range matches {
+				info, err := os.Stat(match)
+				if err != nil {
+					continue
+				}
+
+				if info.ModTime().Before(cutoff) {
+					os.Remove(match)
+				}
+			}
+		}
+	}
+}
+
+// Prefix returns the random filename prefix generated for the current session by Mux.
+//
+// Prefix returns an empty string if the muxer has not been started yet.
+func (muxer *Muxer) Prefix() string {
+	return muxer.prefix
+}
+
+func randomPrefix() (string, error) {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+// Wait waits for the video stream to finish processing.
+//
+// The mux operation must have been started by Mux.
+func (muxer *Muxer) Wait() error {
+	if muxer.cmd == nil {
+		return errors.New("ffmpeg hls: not started")
+	}
+
+	return muxer.cmd.Wait()
+}
+
+// Stop terminates the running ffmpeg process, if any, and stops the recording retention sweep and
+// part synthesizer.
+func (muxer *Muxer) Stop() error {
+	if muxer.pruneStop != nil {
+		close(muxer.pruneStop)
+		muxer.pruneStop = nil
+	}
+
+	if muxer.partStop != nil {
+		close(muxer.partStop)
+		muxer.partStop = nil
+	}
+
+	if muxer.cmd == nil || muxer.cmd.Process == nil {
+		return nil
+	}
+
+	return muxer.cmd.Process.Kill()
+}
+
+// String returns the ffmpeg command used to mux the video stream.
+func (muxer *Muxer) String() string {
+	return "ffmpeg " + strings.Join(muxer.args(), " ")
+}
+
+func (muxer *Muxer) args() []string {
+	args := []string{
+		"-codec", "copy",
+		"-re",
+		"-an",
+	}
+
+	if muxer.Fps != 0 {
+		args = append(args, "-r", strconv.Itoa(muxer.Fps))
+	}
+
+	if muxer.Record.Directory == "" {
+		return append(args, "-f", "hls", muxer.hlsOptions()...)
+	}
+
+	args = append(args, "-f", "tee", "-map", "0:v")
+	args = append(args, muxer.hlsTeeSpec()+"|"+muxer.recordTeeSpec())
+
+	return args
+}
+
+// hlsOptions returns the ffmpeg flags and output path for a standalone (non-tee) HLS output.
+func (muxer *Muxer) hlsOptions() []string {
+	var args []string
+
+	if muxer.SegmentTime != 0 {
+		args = append(args, "-hls_time", strconv.Itoa(muxer.SegmentTime))
+	}
+
+	if muxer.PlaylistSize != 0 {
+		args = append(args, "-hls_list_size", strconv.Itoa(muxer.PlaylistSize))
+	}
+
+	args = append(args, "-hls_flags", muxer.hlsFlags())
+
+	if muxer.LLHLS {
+		// ffmpeg's hls muxer has no option to emit CMAF partial segments directly; synthesizeParts
+		// adds the #EXT-X-PART tags after the fact by splitting each completed fmp4 segment on
+		// byte ranges.
+		args = append(args,
+			"-hls_segment_type", "fmp4",
+			"-hls_fmp4_init_filename", muxer.prefix+"_init.mp4",
+		)
+	}
+
+	if muxer.StorageSize != 0 {
+		args = append(args, "-hls_delete_threshold", strconv.Itoa(muxer.StorageSize))
+	}
+
+	args = append(args, "-hls_segment_filename", path.Join(muxer.Directory, muxer.prefix+"_%d"+muxer.segmentExt()))
+	args = append(args, path.Join(muxer.Directory, "livestream_"+muxer.prefix+".m3u8"))
+
+	return args
+}
+
+// hlsTeeSpec returns the bracketed tee output spec for the HLS side of a concurrent recording
+// tee, per ffmpeg's tee muxer syntax.
+func (muxer *Muxer) hlsTeeSpec() string {
+	opts := fmt.Sprintf("f=hls:hls_flags=%s:hls_segment_filename=%s",
+		muxer.hlsFlags(),
+		path.Join(muxer.Directory, muxer.prefix+"_%d"+muxer.segmentExt()))
+
+	if muxer.SegmentTime != 0 {
+		opts += fmt.Sprintf(":hls_time=%d", muxer.SegmentTime)
+	}
+
+	if muxer.PlaylistSize != 0 {
+		opts += fmt.Sprintf(":hls_list_size=%d", muxer.PlaylistSize)
+	}
+
+	if muxer.LLHLS {
+		// See the equivalent comment in hlsOptions: partial segments are synthesized after the
+		// fact by synthesizeParts, not produced by ffmpeg itself.
+		opts += fmt.Sprintf(":hls_segment_type=fmp4:hls_fmp4_init_filename=%s_init.mp4", muxer.prefix)
+	}
+
+	return "[" + opts + "]" + path.Join(muxer.Directory, "livestream_"+muxer.prefix+".m3u8")
+}
+
+// recordTeeSpec returns the bracketed tee output spec that rolls the recording into wall-clock
+// named MP4 files of Record.SegmentTime duration.
+func (muxer *Muxer) recordTeeSpec() string {
+	segmentTime := muxer.Record.SegmentTime
+	if segmentTime == 0 {
+		segmentTime = defaultRecordSegmentTime
+	}
+
+	opts := fmt.Sprintf("f=segment:segment_time=%d:reset_timestamps=1:strftime=1",
+		int(segmentTime.Seconds()))
+
+	return "[" + opts + "]" + path.Join(muxer.Record.Directory, "rec_%Y%m%d_%H%M%S.mp4")
+}
+
+func (muxer *Muxer) hlsFlags() string {
+	return "+independent_segments+program_date_time"
+}
+
+func (muxer *Muxer) partDuration() float64 {
+	if muxer.PartDuration != 0 {
+		return muxer.PartDuration
+	}
+
+	return defaultPartDuration
+}
+
+func (muxer *Muxer) segmentExt() string {
+	if muxer.LLHLS {
+		return ".m4s"
+	}
+
+	return ".ts"
+}
@@ -0,0 +1,157 @@
+package hls
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// partPollInterval is how often the manifest is checked for segments that still need to be
+// split into parts.
+const partPollInterval = 100 * time.Millisecond
+
+// partHoldBackParts is how many part durations behind the live edge clients are told to request
+// via #EXT-X-SERVER-CONTROL's PART-HOLD-BACK, per the LL-HLS spec's recommendation of at least
+// 3 part target durations.
+const partHoldBackParts = 3
+
+// synthesizeParts rewrites the manifest at manifestPath to add #EXT-X-PART-INF,
+// #EXT-X-SERVER-CONTROL, and per-segment #EXT-X-PART tags, since ffmpeg's hls muxer has no native
+// support for producing CMAF partial segments.
+//
+// Each segment is split into parts by byte range rather than re-muxed, so a part only becomes
+// visible once ffmpeg has finished writing the full segment it belongs to; this buys LL-HLS
+// clients fine-grained blocking-reload tags but not the sub-segment latency a real low-latency
+// packager would provide.
+//
+// synthesizeParts runs until stop is closed.
+func synthesizeParts(manifestPath string, partDuration float64, stop chan struct{}) {
+	ticker := time.NewTicker(partPollInterval)
+	defer ticker.Stop()
+
+	annotated := make(map[string]bool)
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			annotateManifest(manifestPath, partDuration, annotated)
+		}
+	}
+}
+
+// annotateManifest adds LL-HLS header tags, if not already present, and #EXT-X-PART tags for any
+// segment in the manifest that isn't recorded in annotated yet.
+func annotateManifest(manifestPath string, partDuration float64, annotated map[string]bool) {
+	contents, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return
+	}
+
+	lines := strings.Split(string(contents), "\n")
+	directory := filepath.Dir(manifestPath)
+
+	out := make([]string, 0, len(lines))
+	headerDone := containsTag(lines, "#EXT-X-PART-INF")
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if !headerDone && strings.HasPrefix(line, "#EXT-X-TARGETDURATION") {
+			out = append(out,
+				fmt.Sprintf("#EXT-X-PART-INF:PART-TARGET=%s", formatSeconds(partDuration)),
+				fmt.Sprintf("#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=%s",
+					formatSeconds(partDuration*partHoldBackParts)),
+			)
+			headerDone = true
+		}
+
+		if strings.HasPrefix(line, "#EXTINF:") && i+1 < len(lines) && isSegmentURI(lines[i+1]) {
+			uri := lines[i+1]
+			if !annotated[uri] {
+				out = append(out, partLines(directory, uri, parseExtinf(line), partDuration)...)
+				annotated[uri] = true
+			}
+		}
+
+		out = append(out, line)
+	}
+
+	os.WriteFile(manifestPath, []byte(strings.Join(out, "\n")), 0644)
+}
+
+func containsTag(lines []string, tag string) bool {
+	for _, line := range lines {
+		if strings.HasPrefix(line, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isSegmentURI(line string) bool {
+	return line != "" && !strings.HasPrefix(line, "#")
+}
+
+// partLines splits the segment file named uri, in directory, into byte-range parts of roughly
+// partDuration each and returns their #EXT-X-PART tags. It returns nil if the segment's size
+// can't be determined.
+func partLines(directory string, uri string, segmentDuration float64, partDuration float64) []string {
+	info, err := os.Stat(filepath.Join(directory, uri))
+	if err != nil {
+		return nil
+	}
+
+	count := 1
+	if segmentDuration > partDuration {
+		count = int(math.Round(segmentDuration / partDuration))
+	}
+
+	size := info.Size()
+	partSize := size / int64(count)
+	partSeconds := segmentDuration / float64(count)
+
+	lines := make([]string, 0, count)
+	var offset int64
+
+	for i := 0; i < count; i++ {
+		length := partSize
+		if i == count-1 {
+			length = size - offset
+		}
+
+		independent := ""
+		if i == 0 {
+			independent = ",INDEPENDENT=YES"
+		}
+
+		lines = append(lines, fmt.Sprintf("#EXT-X-PART:DURATION=%s,URI=%q,BYTERANGE=%d@%d%s",
+			formatSeconds(partSeconds), uri, length, offset, independent))
+
+		offset += length
+	}
+
+	return lines
+}
+
+func parseExtinf(line string) float64 {
+	value := strings.TrimPrefix(line, "#EXTINF:")
+	value = strings.TrimSuffix(value, ",")
+
+	duration, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+
+	return duration
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', -1, 64)
+}
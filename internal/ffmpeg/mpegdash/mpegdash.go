@@ -1,13 +1,34 @@
 package mpegdash
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"strconv"
+	"time"
 )
 
+// defaultRecordSegmentTime is the rolling recording segment duration used when Record.Directory
+// is set but Record.SegmentTime is not.
+const defaultRecordSegmentTime = 10 * time.Minute
+
+// retentionPollInterval is how often the recording directory is swept for expired files when
+// Record.Retention is set.
+const retentionPollInterval = 1 * time.Minute
+
+// Record configures a concurrent MP4 recording tee alongside the live DASH stream.
+type Record struct {
+	Directory   string
+	SegmentTime time.Duration // Rolling recording segment duration; defaults to 10 minutes
+	Retention   time.Duration // Delete recording files older than this; zero disables cleanup
+}
+
 // Muxer represents a video transformation operation being prepared or run.
 //
 // Ffmpeg will step in and use its own defaults if a value is not provided.
@@ -17,26 +38,69 @@ type Muxer struct {
 	SegmentTime  int // Segment length target duration in seconds
 	PlaylistSize int // Maximum number of playlist entries
 	StorageSize  int // Maximum number of unreferenced segments to keep on disk before removal
-	cmd          *exec.Cmd
+	Record       Record  // Concurrent MP4 recording tee; Record.Directory == "" disables it
+
+	cmd       *exec.Cmd
+	prefix    string
+	pruneStop chan struct{}
 }
 
 var execCommand = exec.Command
 
-// Start begins muxing the video stream to the HLS format.
-func (muxer *Muxer) Start(video io.ReadCloser) error {
+// Mux begins muxing the video stream to the DASH format.
+//
+// Mux generates a random filename prefix for the session so that restarting the muxer doesn't
+// reuse segment names a browser or upstream proxy may still have cached from a previous session.
+func (muxer *Muxer) Mux(video io.ReadCloser) error {
+	prefix, err := randomPrefix()
+	if err != nil {
+		return err
+	}
+	muxer.prefix = prefix
+
+	muxer.cmd = execCommand("ffmpeg", muxer.args()...)
+	muxer.cmd.Stdin = video
+
+	if err := muxer.cmd.Start(); err != nil {
+		return err
+	}
+
+	if muxer.Record.Directory != "" && muxer.Record.Retention != 0 {
+		muxer.pruneStop = make(chan struct{})
+		go pruneRecordings(muxer.Record.Directory, muxer.Record.Retention, muxer.pruneStop)
+	}
+
+	return nil
+}
+
+func (muxer *Muxer) args() []string {
 	args := []string{
 		"-codec", "copy",
-		"-f", "dash",
 		"-re",
 		"-an",
-		"-init_seg_name", "init.m4s",
-		"-media_seg_name", "$Time$-$Number$.m4s",
 	}
 
 	if muxer.Fps != 0 {
 		args = append(args, "-r", strconv.Itoa(muxer.Fps))
 	}
 
+	if muxer.Record.Directory == "" {
+		return append(args, "-f", "dash", muxer.dashOptions()...)
+	}
+
+	args = append(args, "-f", "tee", "-map", "0:v")
+	args = append(args, muxer.dashTeeSpec()+"|"+muxer.recordTeeSpec())
+
+	return args
+}
+
+// dashOptions returns the ffmpeg flags and output path for a standalone (non-tee) DASH output.
+func (muxer *Muxer) dashOptions() []string {
+	args := []string{
+		"-init_seg_name", muxer.prefix + "_init.m4s",
+		"-media_seg_name", muxer.prefix + "_$Time$-$Number$.m4s",
+	}
+
 	if muxer.SegmentTime != 0 {
 		args = append(args, "-seg_duration", strconv.Itoa(muxer.SegmentTime))
 	}
@@ -49,21 +113,115 @@ func (muxer *Muxer) Start(video io.ReadCloser) error {
 		args = append(args, "-extra_window_size", strconv.Itoa(muxer.StorageSize))
 	}
 
-	args = append(args, path.Join(muxer.Directory, "livestream.mpd"))
+	args = append(args, path.Join(muxer.Directory, "livestream_"+muxer.prefix+".mpd"))
 
-	muxer.cmd = execCommand("ffmpeg", args...)
-	muxer.cmd.Stdin = video
+	return args
+}
 
-	return muxer.cmd.Start()
+// dashTeeSpec returns the bracketed tee output spec for the DASH side of a concurrent recording
+// tee, per ffmpeg's tee muxer syntax.
+func (muxer *Muxer) dashTeeSpec() string {
+	opts := fmt.Sprintf("f=dash:init_seg_name=%s_init.m4s:media_seg_name=%s_$Time$-$Number$.m4s",
+		muxer.prefix, muxer.prefix)
+
+	if muxer.SegmentTime != 0 {
+		opts += fmt.Sprintf(":seg_duration=%d", muxer.SegmentTime)
+	}
+
+	if muxer.PlaylistSize != 0 {
+		opts += fmt.Sprintf(":window_size=%d", muxer.PlaylistSize)
+	}
+
+	if muxer.StorageSize != 0 {
+		opts += fmt.Sprintf(":extra_window_size=%d", muxer.StorageSize)
+	}
+
+	return "[" + opts + "]" + path.Join(muxer.Directory, "livestream_"+muxer.prefix+".mpd")
+}
+
+// recordTeeSpec returns the bracketed tee output spec that rolls the recording into wall-clock
+// named MP4 files of Record.SegmentTime duration.
+func (muxer *Muxer) recordTeeSpec() string {
+	segmentTime := muxer.Record.SegmentTime
+	if segmentTime == 0 {
+		segmentTime = defaultRecordSegmentTime
+	}
+
+	opts := fmt.Sprintf("f=segment:segment_time=%d:reset_timestamps=1:strftime=1",
+		int(segmentTime.Seconds()))
+
+	return "[" + opts + "]" + path.Join(muxer.Record.Directory, "rec_%Y%m%d_%H%M%S.mp4")
+}
+
+// pruneRecordings periodically deletes recording files older than retention from directory,
+// until stop is closed.
+func pruneRecordings(directory string, retention time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(retentionPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			matches, err := filepath.Glob(filepath.Join(directory, "rec_*.mp4"))
+			if err != nil {
+				continue
+			}
+
+			cutoff := time.Now().Add(-retention)
+
+			for _, match := range matches {
+				info, err := os.Stat(match)
+				if err != nil {
+					continue
+				}
+
+				if info.ModTime().Before(cutoff) {
+					os.Remove(match)
+				}
+			}
+		}
+	}
+}
+
+// Prefix returns the random filename prefix generated for the current session by Mux.
+//
+// Prefix returns an empty string if the muxer has not been started yet.
+func (muxer *Muxer) Prefix() string {
+	return muxer.prefix
+}
+
+func randomPrefix() (string, error) {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
 }
 
 // Wait waits for the video stream to finish processing.
 //
-// The mux operation must have been started by Start.
+// The mux operation must have been started by Mux.
 func (muxer *Muxer) Wait() error {
 	if muxer.cmd == nil {
 		return errors.New("ffmpeg mpegdash: not started")
 	}
 
 	return muxer.cmd.Wait()
+}
+
+// Stop terminates the running ffmpeg process, if any, and stops the recording retention sweep.
+func (muxer *Muxer) Stop() error {
+	if muxer.pruneStop != nil {
+		close(muxer.pruneStop)
+		muxer.pruneStop = nil
+	}
+
+	if muxer.cmd == nil || muxer.cmd.Process == nil {
+		return nil
+	}
+
+	return muxer.cmd.Process.Kill()
 }
\ No newline at end of file
@@ -0,0 +1,164 @@
+// Package rtmp pushes a raw video stream to a remote RTMP ingest (e.g. YouTube Live, Twitch,
+// Facebook) using ffmpeg.
+package rtmp
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options represents the configuration options for the RTMP output.
+//
+// Ffmpeg will step in and use its own defaults if a value is not provided.
+type Options struct {
+	AudioSource      string // Path or device to pull audio from, if any
+	Bitrate          int    // Target video bitrate in kbps
+	KeyframeInterval int    // Keyframe interval in frames
+}
+
+const (
+	reconnectInitialBackoff = 1 * time.Second
+	reconnectMaxBackoff     = 30 * time.Second
+)
+
+// Muxer represents a video transformation operation that pushes video to a remote RTMP ingest.
+//
+// Unlike the segment-based muxers, Muxer reconnects with exponential backoff whenever the remote
+// ingest drops the connection, since RTMP endpoints regularly disconnect idle or slow publishers.
+type Muxer struct {
+	Url     string
+	Options Options
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	video   io.ReadCloser
+	done    chan struct{}
+	waitErr error
+}
+
+var execCommand = exec.Command
+
+// Mux begins pushing the video stream to the configured RTMP URL.
+//
+// Mux reconnects automatically, with exponential backoff, if the remote ingest drops the
+// connection. Wait only returns once Mux gives up or the video stream is closed.
+func (muxer *Muxer) Mux(video io.ReadCloser) error {
+	if muxer.Url == "" {
+		return errors.New("ffmpeg rtmp: url is required")
+	}
+
+	muxer.video = video
+	muxer.done = make(chan struct{})
+
+	if err := muxer.start(); err != nil {
+		return err
+	}
+
+	go muxer.supervise()
+
+	return nil
+}
+
+// start launches ffmpeg against the configured video reader.
+func (muxer *Muxer) start() error {
+	muxer.mu.Lock()
+	defer muxer.mu.Unlock()
+
+	cmd := execCommand("ffmpeg", muxer.args()...)
+	cmd.Stdin = muxer.video
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	muxer.cmd = cmd
+
+	return nil
+}
+
+// supervise waits on the current ffmpeg process and restarts it with exponential backoff if the
+// ingest drops the connection, until the video stream itself is exhausted.
+func (muxer *Muxer) supervise() {
+	defer close(muxer.done)
+
+	backoff := reconnectInitialBackoff
+
+	for {
+		muxer.mu.Lock()
+		cmd := muxer.cmd
+		muxer.mu.Unlock()
+
+		err := cmd.Wait()
+		if err == nil {
+			muxer.waitErr = nil
+			return
+		}
+
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if backoff > reconnectMaxBackoff {
+			backoff = reconnectMaxBackoff
+		}
+
+		if startErr := muxer.start(); startErr != nil {
+			muxer.waitErr = startErr
+			return
+		}
+	}
+}
+
+// Wait waits for the video stream to finish processing.
+//
+// The mux operation must have been started by Mux.
+func (muxer *Muxer) Wait() error {
+	if muxer.done == nil {
+		return errors.New("ffmpeg rtmp: not started")
+	}
+
+	<-muxer.done
+
+	return muxer.waitErr
+}
+
+// String returns the ffmpeg command used to mux the video stream.
+func (muxer *Muxer) String() string {
+	return "ffmpeg " + strings.Join(muxer.args(), " ")
+}
+
+func (muxer *Muxer) args() []string {
+	var args []string
+
+	if muxer.Options.Bitrate != 0 || muxer.Options.KeyframeInterval != 0 {
+		// Bitrate and GOP structure can't be changed in stream-copy mode, so re-encode whenever
+		// either is requested.
+		args = append(args, "-c:v", "libx264")
+
+		if muxer.Options.Bitrate != 0 {
+			args = append(args, "-b:v", strconv.Itoa(muxer.Options.Bitrate)+"k")
+		}
+
+		if muxer.Options.KeyframeInterval != 0 {
+			args = append(args, "-g", strconv.Itoa(muxer.Options.KeyframeInterval))
+		}
+	} else {
+		args = append(args, "-c:v", "copy")
+	}
+
+	args = append(args, "-f", "flv")
+
+	if muxer.Options.AudioSource != "" {
+		args = append(args, "-i", muxer.Options.AudioSource, "-c:a", "aac")
+	} else {
+		args = append(args, "-an")
+	}
+
+	args = append(args, muxer.Url)
+
+	return args
+}
@@ -0,0 +1,78 @@
+// Package flv serves a live FLV stream to any number of concurrently connected HTTP viewers,
+// fanning a single upstream ffmpeg stream out over GET /live.flv.
+package flv
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Server serves a live FLV stream over HTTP.
+type Server struct {
+	Port int
+	Cert string
+	Key  string
+
+	srv *http.Server
+	hub *hub
+}
+
+// ListenAndServe fans video out to every GET /live.flv viewer and starts the HTTP server.
+//
+// ListenAndServe blocks until the server is shut down or the video stream ends.
+func (server *Server) ListenAndServe(video io.Reader) error {
+	server.hub = newHub()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/live.flv", server.serveLive)
+
+	server.srv = &http.Server{
+		Addr:    fmt.Sprintf(":%d", server.Port),
+		Handler: mux,
+	}
+
+	// Stop serving once the video stream ends
+	go func() {
+		server.hub.run(video)
+		server.srv.Close()
+	}()
+
+	if server.Cert != "" && server.Key != "" {
+		return server.srv.ListenAndServeTLS(server.Cert, server.Key)
+	}
+
+	return server.srv.ListenAndServe()
+}
+
+// Shutdown gracefully shuts down the HTTP server, waiting up to the given deadline for
+// outstanding viewer connections to close.
+func (server *Server) Shutdown(deadline time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+
+	return server.srv.Shutdown(ctx)
+}
+
+func (server *Server) serveLive(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "video/x-flv")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	client := server.hub.subscribe()
+	defer server.hub.unsubscribe(client)
+
+	for tag := range client {
+		if _, err := w.Write(tag); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,141 @@
+package flv
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// flvHeaderSize is the length of the FLV file header plus the PreviousTagSize0 field that
+// immediately follows it.
+const flvHeaderSize = 9 + 4
+
+// flvTagHeaderSize is the length of an FLV tag header, excluding its data payload and the
+// trailing PreviousTagSize field.
+const flvTagHeaderSize = 11
+
+// videoTagType identifies an FLV tag carrying video data.
+const videoTagType = 9
+
+// avcPacketTypeSequenceHeader identifies an AVC video tag carrying the AVCDecoderConfigurationRecord
+// (SPS/PPS) rather than a NALU, per the FLV spec. It's the byte immediately following the
+// FrameType/CodecID byte in an AVC video tag's payload.
+const avcPacketTypeSequenceHeader = 0
+
+// hub fans out FLV tags read from a single source to any number of subscribed viewers, keeping
+// the FLV header, the AVC sequence header, and the most recent keyframe around so that late
+// joiners don't have to wait for the next GOP to start playback.
+//
+// Each viewer gets its own channel buffering up to 64 tags; a tag is dropped for a viewer whose
+// buffer is full. No shared ring buffer of past tags is kept, so a late joiner receives only the
+// header, sequence header and last keyframe, followed by live tags.
+type hub struct {
+	mu             sync.Mutex
+	header         []byte
+	sequenceHeader []byte
+	lastKeyframe   []byte
+	clients        map[chan []byte]struct{}
+}
+
+func newHub() *hub {
+	return &hub{clients: make(map[chan []byte]struct{})}
+}
+
+// subscribe registers a new viewer and returns a channel of FLV tags for it, primed with the
+// stream header, the AVC sequence header, and the last keyframe seen so far, if any, in that
+// order so that flv.js always receives SPS/PPS before any NALU.
+func (h *hub) subscribe() chan []byte {
+	ch := make(chan []byte, 64)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.header != nil {
+		ch <- h.header
+	}
+	if h.sequenceHeader != nil {
+		ch <- h.sequenceHeader
+	}
+	if h.lastKeyframe != nil {
+		ch <- h.lastKeyframe
+	}
+
+	h.clients[ch] = struct{}{}
+
+	return ch
+}
+
+// unsubscribe removes a viewer and closes its channel.
+func (h *hub) unsubscribe(ch chan []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.clients, ch)
+	close(ch)
+}
+
+func (h *hub) broadcast(tag []byte, sequenceHeader bool, keyframe bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if sequenceHeader {
+		h.sequenceHeader = tag
+	} else if keyframe {
+		h.lastKeyframe = tag
+	}
+
+	for ch := range h.clients {
+		select {
+		case ch <- tag:
+		default:
+			// Viewer isn't keeping up; drop the tag rather than block the rest of the viewers.
+		}
+	}
+}
+
+// run reads the FLV header followed by tags from video and broadcasts each one to subscribed
+// viewers until the stream ends.
+func (h *hub) run(video io.Reader) error {
+	r := bufio.NewReader(video)
+
+	header := make([]byte, flvHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	h.header = header
+	h.mu.Unlock()
+
+	for {
+		tagHeader := make([]byte, flvTagHeaderSize)
+		if _, err := io.ReadFull(r, tagHeader); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		dataSize := int(tagHeader[1])<<16 | int(tagHeader[2])<<8 | int(tagHeader[3])
+
+		data := make([]byte, dataSize)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+
+		prevTagSize := make([]byte, 4)
+		if _, err := io.ReadFull(r, prevTagSize); err != nil {
+			return err
+		}
+
+		tag := make([]byte, 0, len(tagHeader)+len(data)+len(prevTagSize))
+		tag = append(tag, tagHeader...)
+		tag = append(tag, data...)
+		tag = append(tag, prevTagSize...)
+
+		isKeyframe := tagHeader[0] == videoTagType && dataSize > 0 && data[0]>>4 == 1
+		sequenceHeader := isKeyframe && dataSize > 1 && data[1] == avcPacketTypeSequenceHeader
+
+		h.broadcast(tag, sequenceHeader, isKeyframe)
+	}
+}
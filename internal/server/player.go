@@ -0,0 +1,69 @@
+package server
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+//go:embed player.html
+var playerHTML string
+
+var playerTemplate = template.Must(template.New("player").Parse(playerHTML))
+
+// servePlayer renders the built-in player page for whichever manifest is currently present in
+// Directory, so that http://<pi>:<port>/ plays the stream without the user having to write their
+// own HTML.
+//
+// The manifest filename is randomized per streaming session, so on a fresh request the pipeline
+// may not have written one yet. servePlayer waits up to blockingReloadTimeout for the on-demand
+// pipeline (already kicked off by OnManifestRequest before servePlayer was called) to produce one,
+// the same way a blocking playlist reload waits for a part to be published.
+func (server *Static) servePlayer(w http.ResponseWriter, r *http.Request) {
+	manifest, kind := waitForManifest(server.Directory)
+	if manifest == "" {
+		http.Error(w, "Video pipeline is still starting", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	playerTemplate.Execute(w, struct {
+		Manifest string
+		Kind     string
+	}{Manifest: manifest, Kind: kind})
+}
+
+// waitForManifest blocks until a DASH or HLS manifest appears in directory, or
+// blockingReloadTimeout elapses.
+func waitForManifest(directory string) (manifest string, kind string) {
+	deadline := time.Now().Add(blockingReloadTimeout)
+
+	for {
+		if manifest, kind := detectManifest(directory); manifest != "" {
+			return manifest, kind
+		}
+
+		if !time.Now().Before(deadline) {
+			return "", ""
+		}
+
+		time.Sleep(reloadPollInterval)
+	}
+}
+
+// detectManifest looks for a DASH or HLS manifest in directory, preferring DASH if both are
+// somehow present, and returns its filename along with "dash" or "hls".
+func detectManifest(directory string) (manifest string, kind string) {
+	if matches, _ := filepath.Glob(filepath.Join(directory, "livestream*.mpd")); len(matches) > 0 {
+		return filepath.Base(matches[0]), "dash"
+	}
+
+	if matches, _ := filepath.Glob(filepath.Join(directory, "livestream*.m3u8")); len(matches) > 0 {
+		return filepath.Base(matches[0]), "hls"
+	}
+
+	return "", ""
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// blockingReloadTimeout bounds how long a manifest request can be held open waiting for the
+// requested media sequence/part to be published, per the LL-HLS spec's recommendation to avoid
+// leaving clients waiting indefinitely on a stalled stream.
+const blockingReloadTimeout = 10 * time.Second
+
+const reloadPollInterval = 50 * time.Millisecond
+
+// manifestHandler wraps handler so that manifest requests (.mpd/.m3u8) are never cached by
+// browsers or upstream proxies, since each streaming session regenerates them from scratch.
+//
+// It additionally makes LL-HLS playlist requests carrying the `_HLS_msn`/`_HLS_part` query
+// parameters block until the requested media sequence/part has been published to the manifest,
+// rather than returning a stale playlist, and invokes onManifestRequest, if set, so that callers
+// can track viewer activity.
+func manifestHandler(directory string, onManifestRequest func(), handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ext := filepath.Ext(r.URL.Path)
+
+		if ext == ".m3u8" || ext == ".mpd" {
+			w.Header().Set("Cache-Control", "no-cache")
+
+			if onManifestRequest != nil {
+				onManifestRequest()
+			}
+		}
+
+		if ext == ".m3u8" {
+			if msn, part, ok := parseReloadParams(r); ok {
+				waitForPart(filepath.Join(directory, filepath.Clean(r.URL.Path)), msn, part)
+			}
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// parseReloadParams extracts the `_HLS_msn` and `_HLS_part` query parameters from a blocking
+// playlist reload request, per the LL-HLS spec. `_HLS_part` is optional and defaults to 0.
+func parseReloadParams(r *http.Request) (msn int, part int, ok bool) {
+	msnParam := r.URL.Query().Get("_HLS_msn")
+	if msnParam == "" {
+		return 0, 0, false
+	}
+
+	msn, err := strconv.Atoi(msnParam)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	if partParam := r.URL.Query().Get("_HLS_part"); partParam != "" {
+		part, err = strconv.Atoi(partParam)
+		if err != nil {
+			return 0, 0, false
+		}
+	}
+
+	return msn, part, true
+}
+
+// waitForPart blocks until the playlist at path advertises the requested media sequence/part (or
+// later), or blockingReloadTimeout elapses.
+func waitForPart(path string, msn int, part int) {
+	deadline := time.Now().Add(blockingReloadTimeout)
+
+	for time.Now().Before(deadline) {
+		if playlistHasPart(path, msn, part) {
+			return
+		}
+
+		time.Sleep(reloadPollInterval)
+	}
+}
+
+// playlistHasPart reports whether the playlist at path has published the given media
+// sequence/part, based on its `#EXT-X-MEDIA-SEQUENCE` and trailing `#EXT-X-PART` tags.
+//
+// `#EXT-X-MEDIA-SEQUENCE` carries the sequence number of the oldest segment in the playlist, per
+// the HLS spec, so the latest published sequence is that plus the number of segments in the
+// playlist, minus one.
+func playlistHasPart(path string, msn int, part int) bool {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	latestSequence := currentMediaSequence(contents) + segmentCount(contents) - 1
+	if latestSequence > msn {
+		return true
+	}
+	if latestSequence < msn {
+		return false
+	}
+
+	return partCountInSequence(contents) > part
+}
+
+func currentMediaSequence(playlist []byte) int {
+	const tag = "#EXT-X-MEDIA-SEQUENCE:"
+
+	idx := bytes.Index(playlist, []byte(tag))
+	if idx == -1 {
+		return 0
+	}
+
+	line := playlist[idx+len(tag):]
+	if end := bytes.IndexByte(line, '\n'); end != -1 {
+		line = line[:end]
+	}
+
+	sequence, err := strconv.Atoi(string(bytes.TrimSpace(line)))
+	if err != nil {
+		return 0
+	}
+
+	return sequence
+}
+
+func segmentCount(playlist []byte) int {
+	return bytes.Count(playlist, []byte("#EXTINF:"))
+}
+
+func partCountInSequence(playlist []byte) int {
+	const tag = "#EXT-X-PART:"
+
+	lastSegment := playlist
+	if idx := bytes.LastIndex(playlist, []byte("#EXTINF:")); idx != -1 {
+		lastSegment = playlist[idx:]
+	}
+
+	return bytes.Count(lastSegment, []byte(tag))
+}
@@ -0,0 +1,78 @@
+// Package server serves the static files generated by the video muxers to HTTP viewers.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// ErrInvalidDirectory indicates that the configured static file directory does not exist.
+var ErrInvalidDirectory = errors.New("server: directory does not exist")
+
+// Static serves the contents of a directory over HTTP.
+type Static struct {
+	Port      int
+	Directory string
+	Cert      string
+	Key       string
+	NoPlayer  bool // Disable the built-in player page served at "/"
+
+	// OnManifestRequest, if set, is called for every manifest request (.mpd/.m3u8) and for every
+	// request for the built-in player page. Used to drive viewer-activity tracking for on-demand
+	// muxer startup.
+	OnManifestRequest func()
+
+	srv *http.Server
+}
+
+// ListenAndServe starts serving the contents of Directory over HTTP.
+//
+// Unless NoPlayer is set, "/" serves a built-in player page for whichever manifest is present in
+// Directory, so that http://<pi>:<port>/ plays the stream out of the box.
+//
+// ListenAndServe blocks until the server is shut down and returns ErrInvalidDirectory if
+// Directory does not exist.
+func (server *Static) ListenAndServe() error {
+	if _, err := os.Stat(server.Directory); os.IsNotExist(err) {
+		return ErrInvalidDirectory
+	}
+
+	fileHandler := manifestHandler(server.Directory, server.OnManifestRequest, http.FileServer(http.Dir(server.Directory)))
+
+	mux := http.NewServeMux()
+	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !server.NoPlayer && r.URL.Path == "/" {
+			if server.OnManifestRequest != nil {
+				server.OnManifestRequest()
+			}
+
+			server.servePlayer(w, r)
+			return
+		}
+
+		fileHandler.ServeHTTP(w, r)
+	}))
+
+	server.srv = &http.Server{
+		Addr:    fmt.Sprintf(":%d", server.Port),
+		Handler: mux,
+	}
+
+	if server.Cert != "" && server.Key != "" {
+		return server.srv.ListenAndServeTLS(server.Cert, server.Key)
+	}
+
+	return server.srv.ListenAndServe()
+}
+
+// Shutdown gracefully shuts down the HTTP server, waiting up to the given deadline.
+func (server *Static) Shutdown(deadline time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+
+	return server.srv.Shutdown(ctx)
+}
@@ -0,0 +1,133 @@
+package video
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jaredpetersen/raspilive/internal/raspivid"
+	"github.com/rs/zerolog/log"
+)
+
+// LifecycleMuxer is a Muxer that can additionally be stopped mid-stream, so that Manager can tear
+// it down while nobody is watching and bring it back up again on demand.
+type LifecycleMuxer interface {
+	Muxer
+	Stop() error
+}
+
+// Manager owns the raspivid + muxer pipeline for a stream, starting it lazily on the first
+// viewer and stopping it again once IdleTimeout has passed with no viewer activity, restarting it
+// on the next request.
+type Manager struct {
+	NewStream   func() (*raspivid.Stream, error)
+	NewMuxer    func() LifecycleMuxer
+	IdleTimeout time.Duration
+
+	mu       sync.Mutex
+	running  bool
+	stream   *raspivid.Stream
+	muxer    LifecycleMuxer
+	lastSeen time.Time
+	epoch    int
+}
+
+// Activity marks a viewer request, lazily starting the pipeline if it isn't already running.
+//
+// Register Activity as a callback on the static file server so that manifest requests keep the
+// pipeline alive and bring it back up on demand.
+func (manager *Manager) Activity() {
+	manager.mu.Lock()
+	manager.lastSeen = time.Now()
+	running := manager.running
+	manager.mu.Unlock()
+
+	if !running {
+		manager.start()
+	}
+}
+
+// Stop unconditionally tears the pipeline down, if it's running. Intended for use on process
+// exit, in addition to the idle watchdog's own calls.
+func (manager *Manager) Stop() {
+	manager.mu.Lock()
+	epoch := manager.epoch
+	manager.mu.Unlock()
+
+	manager.stop(epoch)
+}
+
+func (manager *Manager) start() {
+	manager.mu.Lock()
+	if manager.running {
+		manager.mu.Unlock()
+		return
+	}
+
+	stream, err := manager.NewStream()
+	if err != nil {
+		manager.mu.Unlock()
+		log.Error().Err(err).Msg("Encountered an error streaming video from the Raspberry Pi Camera Module")
+		return
+	}
+
+	muxer := manager.NewMuxer()
+	if err := muxer.Mux(stream.Video); err != nil {
+		manager.mu.Unlock()
+		log.Error().Err(err).Msg("Encountered an error muxing video")
+		return
+	}
+
+	if err := stream.Start(); err != nil {
+		manager.mu.Unlock()
+		log.Error().Err(err).Msg("Encountered an error streaming video from the Raspberry Pi Camera Module")
+		return
+	}
+
+	manager.running = true
+	manager.stream = stream
+	manager.muxer = muxer
+	manager.epoch++
+	epoch := manager.epoch
+	manager.mu.Unlock()
+
+	log.Info().Msg("Starting video pipeline")
+
+	go manager.waitForIdle(epoch)
+}
+
+// waitForIdle stops the pipeline once IdleTimeout has elapsed since the last recorded viewer
+// activity.
+func (manager *Manager) waitForIdle(epoch int) {
+	for {
+		manager.mu.Lock()
+		idleFor := time.Since(manager.lastSeen)
+		manager.mu.Unlock()
+
+		if idleFor >= manager.IdleTimeout {
+			manager.stop(epoch)
+			return
+		}
+
+		time.Sleep(manager.IdleTimeout - idleFor)
+	}
+}
+
+func (manager *Manager) stop(epoch int) {
+	manager.mu.Lock()
+	if !manager.running || manager.epoch != epoch {
+		manager.mu.Unlock()
+		return
+	}
+
+	stream := manager.stream
+	muxer := manager.muxer
+	manager.running = false
+	manager.mu.Unlock()
+
+	log.Info().Msg("Stopping video pipeline")
+
+	stream.Video.Close()
+	muxer.Stop()
+	muxer.Wait()
+	stream.Wait()
+}